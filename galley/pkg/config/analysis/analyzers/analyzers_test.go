@@ -23,6 +23,7 @@ import (
 	"istio.io/istio/galley/pkg/config/analysis"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/auth"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/deprecation"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/egress"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/gateway"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/injection"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/virtualservice"
@@ -171,6 +172,151 @@ var testGrid = []testCase{
 			{msg.GatewayPortNotOnWorkload, "Gateway/httpbin8002-gateway"},
 		},
 	},
+	{
+		name: "jwtIssuerNotConfigured",
+		inputFiles: []string{
+			"testdata/jwt-issuer-not-configured.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			{msg.JwtIssuerNotConfigured, "Policy/default/jwt-example"},
+		},
+	},
+	{
+		name: "jwtUnreachableJwksUri",
+		inputFiles: []string{
+			"testdata/jwt-unreachable-jwksuri.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			{msg.JwtUnreachableJwksUri, "Policy/default/jwt-example"},
+		},
+	},
+	{
+		name: "jwtClaimWithoutIssuer",
+		inputFiles: []string{
+			"testdata/jwt-claim-without-issuer.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			{msg.JwtClaimWithoutIssuer, "ServiceRole/default/bogus-issuer-viewer"},
+		},
+	},
+	{
+		name: "jwtClean",
+		inputFiles: []string{
+			"testdata/jwt-clean.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			// no messages, this test case verifies no false positives
+		},
+	},
+	{
+		name: "jwtAudienceUnknownHost",
+		inputFiles: []string{
+			"testdata/jwt-audience-unknown-host.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			{msg.JwtAudienceUnknownHost, "Policy/default/jwt-example"},
+		},
+	},
+	{
+		name: "jwtIssuerNotScopedForWorkload",
+		inputFiles: []string{
+			"testdata/jwt-issuer-not-scoped-for-workload.yaml",
+		},
+		analyzer: &auth.JWTAuthenticationAnalyzer{},
+		expected: []message{
+			{msg.JwtClaimIssuerNotConfiguredForWorkload, "ServiceRole/default/httpbin-viewer"},
+		},
+	},
+	{
+		name: "egressSidecarHostNotFound",
+		inputFiles: []string{
+			"testdata/egress-sidecar-host-not-found.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			{msg.EgressSidecarHostNotFound, "Sidecar/default/default"},
+		},
+	},
+	{
+		name: "egressServiceEntryPortCollision",
+		inputFiles: []string{
+			"testdata/egress-serviceentry-port-collision.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			{msg.EgressServiceEntryPortCollision, "ServiceEntry/default/reviews-external"},
+		},
+	},
+	{
+		name: "egressDestinationRuleHostIsMeshInternal",
+		inputFiles: []string{
+			"testdata/egress-destinationrule-mesh-internal.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			{msg.EgressDestinationRuleHostIsMeshInternal, "DestinationRule/default/internal-only"},
+		},
+	},
+	{
+		name: "egressVirtualServiceHostNotFound",
+		inputFiles: []string{
+			"testdata/egress-virtualservice-host-not-found.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			{msg.EgressVirtualServiceHostNotFound, "VirtualService/default/default"},
+		},
+	},
+	{
+		name: "egressClean",
+		inputFiles: []string{
+			"testdata/egress-clean.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			// no messages, this test case verifies no false positives
+		},
+	},
+	{
+		name: "egressCleanInMesh",
+		inputFiles: []string{
+			"testdata/egress-clean-inmesh.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			// no messages: a real in-mesh Service whose hostname is referenced by a
+			// VirtualService and a Sidecar egress listener must not be flagged as unknown
+		},
+	},
+	{
+		name: "egressWildcardClean",
+		inputFiles: []string{
+			"testdata/egress-wildcard-clean.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			// no messages: a ServiceEntry host of "*.example.com" covers a VirtualService
+			// and Sidecar egress listener referencing "api.example.com"
+		},
+	},
+	{
+		name: "egressCleanNoFalsePositives",
+		inputFiles: []string{
+			"testdata/egress-clean-no-false-positives.yaml",
+		},
+		analyzer: &egress.Analyzer{},
+		expected: []message{
+			// no messages: a short-name VirtualService host resolved against its own
+			// namespace, a VirtualService bound to an ingress Gateway (out of scope for
+			// this mesh-egress check), and the default catch-all "*/*" Sidecar egress
+			// host must not be flagged
+		},
+	},
 	{
 		name: "deprecation",
 		inputFiles: []string{
@@ -252,6 +398,32 @@ func TestAnalyzers(t *testing.T) {
 	})
 }
 
+// TestDoctorCoverage verifies that AnalyzeVerbose accounts for every resource in each
+// test case's input files: every one of them shows up in the CoverageReport with a
+// terminal status, rather than being silently dropped.
+func TestDoctorCoverage(t *testing.T) {
+	for _, testCase := range testGrid {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			sa := local.NewSourceAnalyzer(metadata.MustGet(), analysis.Combine("testCombined", testCase.analyzer), nil, true)
+			sa.AddFileKubeSource(testCase.inputFiles, "")
+			cancel := make(chan struct{})
+
+			_, report, err := sa.AnalyzeVerbose(cancel)
+			if err != nil {
+				t.Fatalf("Error running doctor analysis on testcase %s: %v", testCase.name, err)
+			}
+
+			g.Expect(report.Resources).ToNot(BeEmpty())
+			for _, rc := range report.Resources {
+				g.Expect(string(rc.Status)).ToNot(BeEmpty())
+			}
+		})
+	}
+}
+
 func TestAnalyzersHaveUniqueNames(t *testing.T) {
 	g := NewGomegaWithT(t)
 
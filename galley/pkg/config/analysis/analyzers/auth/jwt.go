@@ -0,0 +1,274 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	authn "istio.io/api/authentication/v1alpha1"
+	rbac "istio.io/api/rbac/v1alpha1"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// claimIssuerKey is the well-known RBAC constraint key used to gate access on the
+// "iss" claim of a validated JWT.
+const claimIssuerKey = "request.auth.claims[iss]"
+
+// JWTAuthenticationAnalyzer checks Policy resources for common JWT misconfigurations,
+// and cross-references them against ServiceRole constraints that depend on JWT claims.
+type JWTAuthenticationAnalyzer struct{}
+
+var _ analysis.Analyzer = &JWTAuthenticationAnalyzer{}
+
+// Metadata implements Analyzer
+func (a *JWTAuthenticationAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name: "auth.JWTAuthenticationAnalyzer",
+		Description: "Checks JWT authentication policies for unreachable JWKS, audiences that don't match a mesh service, and RBAC " +
+			"rules that depend on claims from an issuer not configured for the workloads they cover",
+		Inputs: collection.Names{
+			metadata.K8SCoreV1Services,
+			metadata.IstioAuthenticationV1Alpha1Policies,
+			metadata.IstioRbacV1Alpha1Serviceroles,
+		},
+	}
+}
+
+// jwtScope is everything collectIssuers learns about the mesh's JWT configuration that
+// the ServiceRole pass needs: every issuer configured anywhere, plus, for every policy,
+// which service hostnames it actually applies to (its "workload selector").
+type jwtScope struct {
+	// allIssuers is every issuer declared by any Policy in the mesh.
+	allIssuers map[string]struct{}
+	// issuersByHost is the set of issuers configured for a given service hostname,
+	// either because a Policy targets it directly or, under a namespace sentinel key,
+	// because a targetless Policy in its namespace covers it. Mesh-wide policies are
+	// not read.
+	issuersByHost map[string]map[string]struct{}
+}
+
+func newJWTScope() *jwtScope {
+	return &jwtScope{
+		allIssuers:    make(map[string]struct{}),
+		issuersByHost: make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *jwtScope) addForHosts(issuer string, hosts []string) {
+	s.allIssuers[issuer] = struct{}{}
+	for _, h := range hosts {
+		if s.issuersByHost[h] == nil {
+			s.issuersByHost[h] = make(map[string]struct{})
+		}
+		s.issuersByHost[h][issuer] = struct{}{}
+	}
+}
+
+// configuredFor reports whether issuer is in scope for host, either because a Policy
+// targets host directly or because a targetless Policy in host's namespace (recorded
+// under a wildcard host key) covers it.
+func (s *jwtScope) configuredFor(issuer, host string) bool {
+	if _, ok := s.issuersByHost[host][issuer]; ok {
+		return true
+	}
+	_, ok := s.issuersByHost[meshWideKey(hostNamespace(host))][issuer]
+	return ok
+}
+
+// meshWideKey is the sentinel issuersByHost key a namespace-wide Policy (one with no
+// explicit Targets) records its issuers under; it covers only hosts in that namespace.
+func meshWideKey(namespace string) string {
+	return "*." + namespace
+}
+
+// Analyze implements Analyzer
+func (a *JWTAuthenticationAnalyzer) Analyze(c analysis.Context) {
+	meshHosts := collectMeshHosts(c)
+	scope := a.collectIssuers(c, meshHosts)
+
+	c.ForEach(metadata.IstioRbacV1Alpha1Serviceroles, func(r *resource.Instance) bool {
+		role := r.Message.(*rbac.ServiceRole)
+		roleNamespace := r.Metadata.Name.String()
+		if idx := strings.Index(roleNamespace, "/"); idx >= 0 {
+			roleNamespace = roleNamespace[:idx]
+		}
+
+		for _, rule := range role.Rules {
+			for _, constraint := range rule.Constraints {
+				if constraint.Key != claimIssuerKey {
+					continue
+				}
+				for _, issuer := range constraint.Values {
+					a.checkClaimIssuer(c, r, issuer, rule.Services, roleNamespace, scope)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// checkClaimIssuer reports one of two distinct problems for a ServiceRole rule that
+// gates access on request.auth.claims[iss]: the issuer isn't declared by any Policy in
+// the mesh at all, or it is declared somewhere but not for the workloads this rule's
+// services select (the "ordering"/workload-selector mismatch called out in the design).
+func (a *JWTAuthenticationAnalyzer) checkClaimIssuer(c analysis.Context, r *resource.Instance, issuer string, services []string, roleNamespace string, scope *jwtScope) {
+	if _, ok := scope.allIssuers[issuer]; !ok {
+		c.Report(metadata.IstioRbacV1Alpha1Serviceroles, msg.NewJwtClaimWithoutIssuer(r, issuer))
+		return
+	}
+
+	for _, svc := range services {
+		host := qualifyHost(svc, roleNamespace)
+		if host == "*" {
+			continue
+		}
+		if !scope.configuredFor(issuer, host) {
+			c.Report(metadata.IstioRbacV1Alpha1Serviceroles, msg.NewJwtClaimIssuerNotConfiguredForWorkload(r, issuer, host))
+		}
+	}
+}
+
+// collectIssuers walks every Policy's JWT origins, reporting JWKS and audience
+// misconfigurations along the way, and returns the resulting jwtScope.
+func (a *JWTAuthenticationAnalyzer) collectIssuers(c analysis.Context, meshHosts map[string]struct{}) *jwtScope {
+	scope := newJWTScope()
+
+	c.ForEach(metadata.IstioAuthenticationV1Alpha1Policies, func(r *resource.Instance) bool {
+		policy := r.Message.(*authn.Policy)
+		policyNamespace := r.Metadata.Name.String()
+		if idx := strings.Index(policyNamespace, "/"); idx >= 0 {
+			policyNamespace = policyNamespace[:idx]
+		}
+
+		hosts := policyTargetHosts(policy, policyNamespace)
+
+		for _, origin := range policy.Origins {
+			jwt := origin.GetJwt()
+			if jwt == nil {
+				continue
+			}
+
+			scope.addForHosts(jwt.Issuer, hosts)
+
+			if jwt.JwksUri == "" && len(jwt.Jwks) == 0 {
+				c.Report(metadata.IstioAuthenticationV1Alpha1Policies, msg.NewJwtIssuerNotConfigured(r, jwt.Issuer))
+				continue
+			}
+
+			if jwt.JwksUri != "" && !isSupportedJwksURI(jwt.JwksUri) {
+				c.Report(metadata.IstioAuthenticationV1Alpha1Policies, msg.NewJwtUnreachableJwksUri(r, jwt.JwksUri))
+			}
+
+			for _, audience := range jwt.Audiences {
+				if !audienceKnown(audience, meshHosts) {
+					c.Report(metadata.IstioAuthenticationV1Alpha1Policies, msg.NewJwtAudienceUnknownHost(r, audience))
+				}
+			}
+		}
+		return true
+	})
+
+	return scope
+}
+
+// policyTargetHosts returns the service hostnames a Policy applies to: the explicit
+// Targets if any are set, or the namespace-wide sentinel key if the Policy has none
+// (Istio treats a targetless Policy as applying to every workload in its namespace).
+func policyTargetHosts(policy *authn.Policy, namespace string) []string {
+	if len(policy.Targets) == 0 {
+		return []string{meshWideKey(namespace)}
+	}
+	hosts := make([]string, 0, len(policy.Targets))
+	for _, t := range policy.Targets {
+		hosts = append(hosts, fmt.Sprintf("%s.%s.svc.cluster.local", t.Name, namespace))
+	}
+	return hosts
+}
+
+// qualifyHost turns a ServiceRole rule's service entry (a short name, an FQDN, or "*")
+// into the fully-qualified hostname used as a jwtScope key.
+func qualifyHost(service, defaultNamespace string) string {
+	if service == "*" || strings.Contains(service, ".svc.cluster.local") {
+		return service
+	}
+	if strings.Contains(service, ".") {
+		// Already namespace-qualified (e.g. "reviews.default").
+		return service + ".svc.cluster.local"
+	}
+	return fmt.Sprintf("%s.%s.svc.cluster.local", service, defaultNamespace)
+}
+
+// hostNamespace extracts the namespace component out of a "name.namespace.svc.cluster.local" hostname.
+func hostNamespace(host string) string {
+	parts := strings.SplitN(host, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// collectMeshHosts returns every DNS name a Kubernetes Service in the mesh is reachable
+// at, used to validate JWT audiences against.
+func collectMeshHosts(c analysis.Context) map[string]struct{} {
+	hosts := make(map[string]struct{})
+	c.ForEach(metadata.K8SCoreV1Services, func(r *resource.Instance) bool {
+		_ = r.Message.(*corev1.Service)
+		fullName := r.Metadata.Name.String()
+		parts := strings.SplitN(fullName, "/", 2)
+		if len(parts) != 2 {
+			return true
+		}
+		ns, name := parts[0], parts[1]
+		hosts[fmt.Sprintf("%s.%s.svc.cluster.local", name, ns)] = struct{}{}
+		hosts[fmt.Sprintf("%s.%s", name, ns)] = struct{}{}
+		return true
+	})
+	return hosts
+}
+
+// audienceKnown reports whether a JWT audience string matches a known mesh service
+// hostname, either exactly or as a scheme-qualified URL (e.g. "https://host").
+func audienceKnown(audience string, meshHosts map[string]struct{}) bool {
+	host := audience
+	if idx := strings.Index(host, "://"); idx >= 0 {
+		host = host[idx+3:]
+	}
+	host = strings.TrimSuffix(host, "/")
+	_, ok := meshHosts[host]
+	return ok
+}
+
+// isSupportedJwksURI does a cheap, offline sanity check on a jwksUri: Envoy can only
+// fetch it if it is an absolute http(s) URL or a local file reference.
+func isSupportedJwksURI(uri string) bool {
+	switch {
+	case len(uri) >= 7 && uri[:7] == "http://":
+		return true
+	case len(uri) >= 8 && uri[:8] == "https://":
+		return true
+	case len(uri) >= 7 && uri[:7] == "file://":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	v1alpha3 "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// Analyzer cross-references ServiceEntry, Sidecar egress listeners, VirtualService and
+// DestinationRule to catch external-traffic configuration that silently has no effect.
+type Analyzer struct{}
+
+var _ analysis.Analyzer = &Analyzer{}
+
+// Metadata implements Analyzer
+func (a *Analyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "egress.Analyzer",
+		Description: "Checks that ServiceEntry, Sidecar egress, VirtualService and DestinationRule agree on what traffic actually leaves the mesh",
+		Inputs: collection.Names{
+			metadata.K8SCoreV1Services,
+			metadata.IstioNetworkingV1Alpha3Serviceentries,
+			metadata.IstioNetworkingV1Alpha3Sidecars,
+			metadata.IstioNetworkingV1Alpha3Virtualservices,
+			metadata.IstioNetworkingV1Alpha3Destinationrules,
+		},
+	}
+}
+
+// Analyze implements Analyzer
+func (a *Analyzer) Analyze(c analysis.Context) {
+	meshServices := make(map[string]*corev1.Service)
+	meshShortNames := make(map[string]map[string]struct{})
+	c.ForEach(metadata.K8SCoreV1Services, func(r *resource.Instance) bool {
+		svc := r.Message.(*corev1.Service)
+		for _, host := range serviceHostnames(r.Metadata.Name.String()) {
+			meshServices[host] = svc
+		}
+		ns, name := splitNamespacedName(r.Metadata.Name.String())
+		if meshShortNames[ns] == nil {
+			meshShortNames[ns] = make(map[string]struct{})
+		}
+		meshShortNames[ns][name] = struct{}{}
+		return true
+	})
+
+	seHosts := make(map[string]struct{})
+	meshInternalHosts := make(map[string]struct{})
+	c.ForEach(metadata.IstioNetworkingV1Alpha3Serviceentries, func(r *resource.Instance) bool {
+		se := r.Message.(*v1alpha3.ServiceEntry)
+		for _, host := range se.Hosts {
+			seHosts[host] = struct{}{}
+			if se.Location == v1alpha3.ServiceEntry_MESH_INTERNAL {
+				meshInternalHosts[host] = struct{}{}
+			}
+		}
+		a.checkPortCollisions(c, r, se, meshServices)
+		return true
+	})
+
+	c.ForEach(metadata.IstioNetworkingV1Alpha3Sidecars, func(r *resource.Instance) bool {
+		ns, _ := splitNamespacedName(r.Metadata.Name.String())
+		sidecar := r.Message.(*v1alpha3.Sidecar)
+		for _, eg := range sidecar.Egress {
+			for _, host := range eg.Hosts {
+				stripped := stripNamespace(host)
+				if stripped == "*" {
+					// The catch-all egress host ("*/*" or "./*") is how every Sidecar,
+					// including the mesh-wide default, opts into same-namespace/mesh
+					// traffic; it isn't scoped to a specific external destination.
+					continue
+				}
+				if !hostKnown(stripped, ns, meshServices, meshShortNames, seHosts) {
+					c.Report(metadata.IstioNetworkingV1Alpha3Sidecars, msg.NewEgressSidecarHostNotFound(r, host))
+				}
+			}
+		}
+		return true
+	})
+
+	c.ForEach(metadata.IstioNetworkingV1Alpha3Virtualservices, func(r *resource.Instance) bool {
+		vs := r.Message.(*v1alpha3.VirtualService)
+		if !isMeshBound(vs) {
+			// Gateway-bound VirtualServices route ingress traffic, not egress from
+			// mesh workloads, so their hosts aren't subject to this check.
+			return true
+		}
+		ns, _ := splitNamespacedName(r.Metadata.Name.String())
+		for _, host := range vs.Hosts {
+			if host == "*" {
+				continue
+			}
+			if !hostKnown(host, ns, meshServices, meshShortNames, seHosts) {
+				c.Report(metadata.IstioNetworkingV1Alpha3Virtualservices, msg.NewEgressVirtualServiceHostNotFound(r, host))
+			}
+		}
+		return true
+	})
+
+	c.ForEach(metadata.IstioNetworkingV1Alpha3Destinationrules, func(r *resource.Instance) bool {
+		dr := r.Message.(*v1alpha3.DestinationRule)
+		if _, ok := meshInternalHosts[dr.Host]; ok {
+			c.Report(metadata.IstioNetworkingV1Alpha3Destinationrules, msg.NewEgressDestinationRuleHostIsMeshInternal(r, dr.Host))
+		}
+		return true
+	})
+}
+
+// serviceHostnames returns the DNS names a Kubernetes Service is reachable at: its full
+// cluster-local FQDN and the shorter "name.namespace" form some configs use.
+func serviceHostnames(fullName string) []string {
+	ns, name := splitNamespacedName(fullName)
+	if ns == "" && name == "" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("%s.%s.svc.cluster.local", name, ns),
+		fmt.Sprintf("%s.%s", name, ns),
+	}
+}
+
+// splitNamespacedName splits a resource's "<namespace>/<name>" metadata name into its
+// two parts, returning ("", "") if fullName isn't in that form.
+func splitNamespacedName(fullName string) (namespace, name string) {
+	parts := strings.SplitN(fullName, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// checkPortCollisions reports a ServiceEntry port whose number and protocol already
+// belong to an in-mesh Service of the same host.
+func (a *Analyzer) checkPortCollisions(c analysis.Context, r *resource.Instance, se *v1alpha3.ServiceEntry, meshServices map[string]*corev1.Service) {
+	for _, host := range se.Hosts {
+		svc, ok := meshServices[host]
+		if !ok {
+			continue
+		}
+		for _, sePort := range se.Ports {
+			for _, svcPort := range svc.Spec.Ports {
+				if portsCollide(sePort, svcPort) {
+					c.Report(metadata.IstioNetworkingV1Alpha3Serviceentries,
+						msg.NewEgressServiceEntryPortCollision(r, fmt.Sprintf("%s:%d/%s", host, sePort.Number, sePort.Protocol)))
+				}
+			}
+		}
+	}
+}
+
+// portsCollide reports whether a ServiceEntry port and a Kubernetes Service port
+// describe the same number and a compatible protocol.
+func portsCollide(sePort *v1alpha3.Port, svcPort corev1.ServicePort) bool {
+	if sePort.Number != uint32(svcPort.Port) {
+		return false
+	}
+	return protocolsCompatible(sePort.Protocol, string(svcPort.Protocol))
+}
+
+// protocolsCompatible reports whether an Istio port protocol (HTTP, HTTPS, TCP, TLS,
+// GRPC, ...) and a Kubernetes Service port protocol (TCP, UDP, SCTP) describe the same
+// transport, which is all a Kubernetes Service port can actually distinguish. An empty
+// k8sProtocol means the field was left unset, which Kubernetes itself defaults to TCP.
+func protocolsCompatible(istioProtocol, k8sProtocol string) bool {
+	if strings.EqualFold(istioProtocol, k8sProtocol) {
+		return true
+	}
+	if strings.EqualFold(k8sProtocol, "UDP") {
+		return false
+	}
+	// Every non-UDP Istio application protocol (HTTP, HTTPS, GRPC, TLS, TCP, Mongo, ...)
+	// rides over a TCP Kubernetes Service port, same as an unset (default-TCP) k8sProtocol.
+	return k8sProtocol == "" || strings.EqualFold(k8sProtocol, "TCP")
+}
+
+// hostKnown reports whether host resolves to either an in-mesh Service or a
+// ServiceEntry, including a wildcard-domain ServiceEntry host (e.g. "*.example.com")
+// that covers it. A short, unqualified host (e.g. "reviews") is resolved against the
+// namespace of the resource declaring it, the same way the Kubernetes resolver would.
+func hostKnown(host, namespace string, meshServices map[string]*corev1.Service, meshShortNames map[string]map[string]struct{}, seHosts map[string]struct{}) bool {
+	if !strings.Contains(host, ".") {
+		_, ok := meshShortNames[namespace][host]
+		return ok
+	}
+	if _, ok := meshServices[host]; ok {
+		return true
+	}
+	if _, ok := seHosts[host]; ok {
+		return true
+	}
+	for seHost := range seHosts {
+		if wildcardHostMatches(seHost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMeshBound reports whether a VirtualService applies to mesh sidecars (and is
+// therefore in scope for this egress check), as opposed to being bound only to one or
+// more named Gateways, which carry ingress/reverse-proxy traffic.
+func isMeshBound(vs *v1alpha3.VirtualService) bool {
+	if len(vs.Gateways) == 0 {
+		return true
+	}
+	for _, gw := range vs.Gateways {
+		if gw == "mesh" {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardHostMatches reports whether host is covered by a ServiceEntry wildcard host
+// such as "*.example.com" or "*". A wildcard only ever matches subdomains, so
+// "*.example.com" covers "api.example.com" but not the bare "example.com".
+func wildcardHostMatches(wildcard, host string) bool {
+	if wildcard == "*" {
+		return true
+	}
+	if !strings.HasPrefix(wildcard, "*.") {
+		return false
+	}
+	return strings.HasSuffix(host, strings.TrimPrefix(wildcard, "*"))
+}
+
+// stripNamespace strips the "<namespace>/" selector prefix Sidecar egress hosts are
+// written with (e.g. "*/httpbin.example.com"), leaving just the host part.
+func stripNamespace(host string) string {
+	if idx := strings.Index(host, "/"); idx >= 0 {
+		return host[idx+1:]
+	}
+	return host
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package local runs Analyzers against resources loaded from local sources (today:
+// Kubernetes YAML files on disk), without requiring a live apiserver connection.
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/diag"
+	"istio.io/istio/galley/pkg/config/meta/schema"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// CollectionReporterFn is invoked every time an analyzer reads from a collection, so
+// callers (typically tests) can confirm an analyzer's declared Metadata().Inputs match
+// what it actually touches.
+type CollectionReporterFn func(collection.Name)
+
+// SourceAnalyzer loads resources from local sources and runs an analysis.Analyzer
+// (often an analysis.Combine of several) over them.
+type SourceAnalyzer struct {
+	schema             *schema.Metadata
+	analyzer           analysis.Analyzer
+	cr                 CollectionReporterFn
+	disableCrdAnalyzer bool
+
+	store *resourceStore
+}
+
+// NewSourceAnalyzer returns a SourceAnalyzer that will run analyzer over whatever
+// resources are added to it before Analyze or AnalyzeVerbose is called.
+func NewSourceAnalyzer(m *schema.Metadata, analyzer analysis.Analyzer, cr CollectionReporterFn, disableCrdAnalyzer bool) *SourceAnalyzer {
+	return &SourceAnalyzer{
+		schema:             m,
+		analyzer:           analyzer,
+		cr:                 cr,
+		disableCrdAnalyzer: disableCrdAnalyzer,
+		store:              newResourceStore(),
+	}
+}
+
+// AddFileKubeSource parses each file as a stream of Kubernetes YAML documents and adds
+// the resulting resources to the analyzer's working set. defaultNamespace is used for
+// any resource that doesn't set metadata.namespace.
+func (sa *SourceAnalyzer) AddFileKubeSource(files []string, defaultNamespace string) error {
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("error reading file %q: %v", f, err)
+		}
+		if err := sa.store.addYAML(sa.schema, f, b, defaultNamespace); err != nil {
+			return fmt.Errorf("error parsing file %q: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// Analyze runs the configured analyzer and returns the diag.Messages it reported.
+func (sa *SourceAnalyzer) Analyze(cancel <-chan struct{}) ([]diag.Message, error) {
+	msgs, _, err := sa.run(cancel, newCoverageRecorder())
+	return msgs, err
+}
+
+// AnalyzeVerbose behaves like Analyze, but additionally returns a CoverageReport
+// describing, for every resource in the working set, which analyzers visited it, which
+// collections it belonged to, which references it resolved, and whether it ended up
+// processed, skipped, or left with an unresolved reference.
+func (sa *SourceAnalyzer) AnalyzeVerbose(cancel <-chan struct{}) ([]diag.Message, *CoverageReport, error) {
+	return sa.run(cancel, newCoverageRecorder())
+}
+
+func (sa *SourceAnalyzer) run(cancel <-chan struct{}, rec *coverageRecorder) ([]diag.Message, *CoverageReport, error) {
+	analyzerName := sa.analyzer.Metadata().Name
+	rec.registerResources(sa.store)
+
+	ctx := &analyzerContext{
+		store:    sa.store,
+		cr:       sa.cr,
+		rec:      rec,
+		analyzer: analyzerName,
+		cancel:   cancel,
+	}
+
+	sa.analyzer.Analyze(ctx)
+
+	return ctx.messages, rec.buildReport(), nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"istio.io/istio/galley/pkg/config/analysis/diag"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// analyzerContext is the analysis.Context implementation SourceAnalyzer hands to the
+// configured analyzer. Every read is funneled through here so it can be recorded for
+// both the legacy CollectionReporterFn hook and the richer coverageRecorder.
+type analyzerContext struct {
+	store    *resourceStore
+	cr       CollectionReporterFn
+	rec      *coverageRecorder
+	analyzer string
+	cancel   <-chan struct{}
+	messages []diag.Message
+
+	// current is the resource whose analysis triggered the ForEach callback Find/Exists
+	// is being called from, so RecordReference can attribute the reference to the
+	// resource that made it rather than the one it resolved against. Empty outside of
+	// a ForEach callback.
+	current resource.FullName
+}
+
+func (ctx *analyzerContext) touch(col collection.Name) {
+	if ctx.cr != nil {
+		ctx.cr(col)
+	}
+}
+
+// ForEach implements analysis.Context.
+func (ctx *analyzerContext) ForEach(col collection.Name, fn func(r *resource.Instance) bool) {
+	ctx.touch(col)
+	for _, r := range ctx.store.byCollection[col] {
+		ctx.rec.RecordVisit(ctx.analyzer, r, col)
+
+		prev := ctx.current
+		ctx.current = r.Metadata.Name
+		cont := fn(r)
+		ctx.current = prev
+
+		if !cont {
+			return
+		}
+	}
+}
+
+// Find implements analysis.Context.
+func (ctx *analyzerContext) Find(col collection.Name, name resource.FullName) *resource.Instance {
+	ctx.touch(col)
+	for _, r := range ctx.store.byCollection[col] {
+		if r.Metadata.Name == name {
+			ctx.rec.RecordReference(ctx.analyzer, ctx.current, col, name, true)
+			return r
+		}
+	}
+	ctx.rec.RecordReference(ctx.analyzer, ctx.current, col, name, false)
+	return nil
+}
+
+// Exists implements analysis.Context.
+func (ctx *analyzerContext) Exists(col collection.Name, name resource.FullName) bool {
+	return ctx.Find(col, name) != nil
+}
+
+// Report implements analysis.Context.
+func (ctx *analyzerContext) Report(col collection.Name, m diag.Message) {
+	ctx.messages = append(ctx.messages, m)
+}
+
+// Canceled implements analysis.Context.
+func (ctx *analyzerContext) Canceled() bool {
+	select {
+	case <-ctx.cancel:
+		return true
+	default:
+		return false
+	}
+}
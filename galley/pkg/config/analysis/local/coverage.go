@@ -0,0 +1,198 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// ResourceStatus is the terminal disposition of a resource after a doctor run.
+type ResourceStatus string
+
+const (
+	// Processed means at least one analyzer visited the resource.
+	Processed ResourceStatus = "processed"
+	// Skipped means the resource was loaded but no analyzer ever visited it.
+	Skipped ResourceStatus = "skipped"
+	// ReferencedDescriptorNotFound means something referenced this resource by name,
+	// but it was never actually in the working set.
+	ReferencedDescriptorNotFound ResourceStatus = "referenced descriptor not found"
+)
+
+// ReferenceOutcome records whether a reference an analyzer made to another resource,
+// identified by collection and name, actually resolved.
+type ReferenceOutcome struct {
+	Collection collection.Name
+	Target     resource.FullName
+	Resolved   bool
+}
+
+// ResourceCoverage is everything doctor mode knows about a single resource.
+type ResourceCoverage struct {
+	ID         resource.FullName
+	Kind       string
+	Collection collection.Name
+	Analyzers  []string
+	References []ReferenceOutcome
+	Status     ResourceStatus
+}
+
+// CoverageReport is the result of a doctor run: one ResourceCoverage per resource seen,
+// plus any references that never resolved to a resource in the working set at all.
+type CoverageReport struct {
+	Resources      []ResourceCoverage
+	UnresolvedRefs []ReferenceOutcome
+}
+
+// FormatDoctor renders the report as one line per resource, in the style of
+// `debug doctor --verbose`: terse, stable, grep-friendly.
+func (r *CoverageReport) FormatDoctor() []string {
+	lines := make([]string, 0, len(r.Resources))
+	for _, rc := range r.Resources {
+		analyzers := append([]string(nil), rc.Analyzers...)
+		sort.Strings(analyzers)
+
+		refs := make([]string, 0, len(rc.References))
+		for _, ref := range rc.References {
+			mark := "ok"
+			if !ref.Resolved {
+				mark = "unresolved"
+			}
+			refs = append(refs, fmt.Sprintf("%s/%s:%s", ref.Collection, ref.Target, mark))
+		}
+
+		line := fmt.Sprintf("%s/%s [collection=%s analyzers=%s]", rc.Kind, rc.ID, rc.Collection, formatList(analyzers))
+		if len(refs) > 0 {
+			line += fmt.Sprintf(" [refs=%s]", formatList(refs))
+		}
+		line += fmt.Sprintf(" -- %s", rc.Status)
+
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func formatList(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ",")
+}
+
+// CoverageRecorder is notified of every resource visit and reference resolution an
+// analyzer performs while running under SourceAnalyzer, so that a CoverageReport can be
+// built once the run completes.
+type CoverageRecorder interface {
+	RecordVisit(analyzer string, r *resource.Instance, col collection.Name)
+	RecordReference(analyzer string, source resource.FullName, col collection.Name, target resource.FullName, resolved bool)
+	Report() *CoverageReport
+}
+
+type coverageRecorder struct {
+	mu         sync.Mutex
+	resources  map[resource.FullName]*ResourceCoverage
+	unresolved []ReferenceOutcome
+}
+
+func newCoverageRecorder() *coverageRecorder {
+	return &coverageRecorder{resources: make(map[resource.FullName]*ResourceCoverage)}
+}
+
+// registerResources seeds every resource currently in store as "skipped", so resources
+// no analyzer ever visits still show up in the final report.
+func (c *coverageRecorder) registerResources(store *resourceStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for col, rs := range store.byCollection {
+		for _, r := range rs {
+			c.resources[r.Metadata.Name] = &ResourceCoverage{
+				ID:         r.Metadata.Name,
+				Kind:       r.Origin.Kind(),
+				Collection: col,
+				Status:     Skipped,
+			}
+		}
+	}
+}
+
+// RecordVisit implements CoverageRecorder.
+func (c *coverageRecorder) RecordVisit(analyzer string, r *resource.Instance, col collection.Name) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rc, ok := c.resources[r.Metadata.Name]
+	if !ok {
+		rc = &ResourceCoverage{ID: r.Metadata.Name, Kind: r.Origin.Kind(), Collection: col}
+		c.resources[r.Metadata.Name] = rc
+	}
+	rc.Status = Processed
+	for _, a := range rc.Analyzers {
+		if a == analyzer {
+			return
+		}
+	}
+	rc.Analyzers = append(rc.Analyzers, analyzer)
+}
+
+// RecordReference implements CoverageRecorder. The outcome is attached to the resource
+// that made the reference (source), not the one it resolved against (target): that's
+// the resource whose ResourceCoverage.References the doctor report is meant to surface.
+// An unresolved reference additionally gets a standalone phantom entry for target, so a
+// resource referenced by name but never actually present still shows up in the report.
+func (c *coverageRecorder) RecordReference(analyzer string, source resource.FullName, col collection.Name, target resource.FullName, resolved bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	outcome := ReferenceOutcome{Collection: col, Target: target, Resolved: resolved}
+	if rc, ok := c.resources[source]; ok {
+		rc.References = append(rc.References, outcome)
+	}
+
+	if !resolved {
+		if _, ok := c.resources[target]; !ok {
+			c.resources[target] = &ResourceCoverage{
+				ID:         target,
+				Collection: col,
+				Status:     ReferencedDescriptorNotFound,
+			}
+		}
+		c.unresolved = append(c.unresolved, outcome)
+	}
+}
+
+// Report implements CoverageRecorder.
+func (c *coverageRecorder) Report() *CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.buildReport()
+}
+
+// buildReport is the lock-free core of Report, also used internally by SourceAnalyzer.
+func (c *coverageRecorder) buildReport() *CoverageReport {
+	report := &CoverageReport{UnresolvedRefs: append([]ReferenceOutcome(nil), c.unresolved...)}
+	for _, rc := range c.resources {
+		report.Resources = append(report.Resources, *rc)
+	}
+	return report
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// referenceAnalyzer exercises Context.Find from within a Context.ForEach callback, so
+// the test below can check which resource a reference gets attributed to.
+type referenceAnalyzer struct{}
+
+func (referenceAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:   "test.referenceAnalyzer",
+		Inputs: collection.Names{metadata.K8SCoreV1Services},
+	}
+}
+
+func (referenceAnalyzer) Analyze(c analysis.Context) {
+	c.ForEach(metadata.K8SCoreV1Services, func(r *resource.Instance) bool {
+		if r.Metadata.Name.String() != "default/frontend" {
+			return true
+		}
+		c.Find(metadata.K8SCoreV1Services, resource.NewFullName(resource.Namespace("default"), resource.LocalName("backend")))
+		c.Find(metadata.K8SCoreV1Services, resource.NewFullName(resource.Namespace("default"), resource.LocalName("missing")))
+		return true
+	})
+}
+
+// TestRecordReference_attributesToSource verifies that a reference made while analyzing
+// one resource shows up on that resource's own ResourceCoverage.References, not on the
+// resource it was resolved against.
+func TestRecordReference_attributesToSource(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	sa := NewSourceAnalyzer(metadata.MustGet(), referenceAnalyzer{}, nil, true)
+	err := sa.store.addYAML(sa.schema, "test", []byte(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  namespace: default
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: backend
+  namespace: default
+`), "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, report, err := sa.AnalyzeVerbose(make(chan struct{}))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	byID := make(map[string]ResourceCoverage)
+	for _, rc := range report.Resources {
+		byID[rc.ID.String()] = rc
+	}
+
+	frontend, ok := byID["default/frontend"]
+	g.Expect(ok).To(BeTrue())
+	g.Expect(frontend.References).To(ConsistOf(
+		ReferenceOutcome{Collection: metadata.K8SCoreV1Services, Target: resource.NewFullName(resource.Namespace("default"), resource.LocalName("backend")), Resolved: true},
+		ReferenceOutcome{Collection: metadata.K8SCoreV1Services, Target: resource.NewFullName(resource.Namespace("default"), resource.LocalName("missing")), Resolved: false},
+	))
+
+	backend, ok := byID["default/backend"]
+	g.Expect(ok).To(BeTrue())
+	g.Expect(backend.References).To(BeEmpty())
+
+	missing, ok := byID["default/missing"]
+	g.Expect(ok).To(BeTrue())
+	g.Expect(missing.Status).To(Equal(ReferencedDescriptorNotFound))
+}
+
+// TestFormatDoctor verifies the terse, grep-friendly line format istioctl's
+// "--verbose" doctor output is built on: one sorted line per resource, with the
+// analyzers that visited it, its reference-resolution outcomes, and its terminal
+// status.
+func TestFormatDoctor(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	report := &CoverageReport{
+		Resources: []ResourceCoverage{
+			{
+				ID:         resource.NewFullName(resource.Namespace("default"), resource.LocalName("frontend")),
+				Kind:       "Service",
+				Collection: metadata.K8SCoreV1Services,
+				Analyzers:  []string{"test.referenceAnalyzer"},
+				References: []ReferenceOutcome{
+					{Collection: metadata.K8SCoreV1Services, Target: resource.NewFullName(resource.Namespace("default"), resource.LocalName("backend")), Resolved: true},
+					{Collection: metadata.K8SCoreV1Services, Target: resource.NewFullName(resource.Namespace("default"), resource.LocalName("missing")), Resolved: false},
+				},
+				Status: Processed,
+			},
+			{
+				ID:         resource.NewFullName(resource.Namespace("default"), resource.LocalName("unused")),
+				Kind:       "Service",
+				Collection: metadata.K8SCoreV1Services,
+				Status:     Skipped,
+			},
+		},
+	}
+
+	backendRef := fmt.Sprintf("%s/%s:ok", metadata.K8SCoreV1Services, report.Resources[0].References[0].Target)
+	missingRef := fmt.Sprintf("%s/%s:unresolved", metadata.K8SCoreV1Services, report.Resources[0].References[1].Target)
+
+	lines := report.FormatDoctor()
+	g.Expect(lines).To(Equal([]string{
+		fmt.Sprintf("Service/default/frontend [collection=%s analyzers=test.referenceAnalyzer] [refs=%s,%s] -- processed",
+			metadata.K8SCoreV1Services, backendRef, missingRef),
+		fmt.Sprintf("Service/default/unused [collection=%s analyzers=-] -- skipped", metadata.K8SCoreV1Services),
+	}))
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+
+	k8syaml "sigs.k8s.io/yaml"
+
+	"istio.io/istio/galley/pkg/config/meta/schema"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// resourceStore is the in-memory working set a SourceAnalyzer runs over: every resource
+// that's been added, grouped by the collection it belongs to.
+type resourceStore struct {
+	byCollection map[collection.Name][]*resource.Instance
+}
+
+func newResourceStore() *resourceStore {
+	return &resourceStore{byCollection: make(map[collection.Name][]*resource.Instance)}
+}
+
+func (s *resourceStore) all() []*resource.Instance {
+	var all []*resource.Instance
+	for _, rs := range s.byCollection {
+		all = append(all, rs...)
+	}
+	return all
+}
+
+// addYAML splits data on "---" document separators, decodes each document against the
+// collection its apiVersion/kind maps to in m, and adds the result to the store.
+func (s *resourceStore) addYAML(m *schema.Metadata, origin string, data []byte, defaultNamespace string) error {
+	for i, doc := range bytes.Split(data, []byte("\n---")) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		var head struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := k8syaml.Unmarshal(doc, &head); err != nil {
+			return fmt.Errorf("%s[%d]: %v", origin, i, err)
+		}
+		if head.Kind == "" {
+			continue
+		}
+
+		col, msgFactory, ok := m.KindToCollection(head.APIVersion, head.Kind)
+		if !ok {
+			return fmt.Errorf("%s[%d]: unknown resource kind %q", origin, i, head.Kind)
+		}
+
+		body, err := msgFactory()
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %v", origin, i, err)
+		}
+		if err := k8syaml.Unmarshal(doc, body); err != nil {
+			return fmt.Errorf("%s[%d]: %v", origin, i, err)
+		}
+
+		ns := head.Metadata.Namespace
+		if ns == "" {
+			ns = defaultNamespace
+		}
+
+		s.byCollection[col] = append(s.byCollection[col], &resource.Instance{
+			Metadata: resource.Metadata{
+				Name: resource.NewFullName(resource.Namespace(ns), resource.LocalName(head.Metadata.Name)),
+			},
+			Message: body,
+			Origin:  resource.NewOrigin(head.Kind, origin),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// GENERATED FILE -- DO NOT EDIT
+//
+// Code generated by analyzer documentation generator; entries are appended here, one
+// per analyzer check, as new checks are added. See diag.MessageType for the meaning of
+// each field.
+
+package msg
+
+import (
+	"istio.io/istio/galley/pkg/config/analysis/diag"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+var (
+	// JwtIssuerNotConfigured defines a diag.MessageType for message "JwtIssuerNotConfigured".
+	// Description: A JWT origin has neither a jwksUri nor inline jwks, so tokens it issues can never be validated.
+	JwtIssuerNotConfigured = diag.NewMessageType(diag.Error, "IST0150", "JWT issuer %q has neither a jwksUri nor inline jwks configured, so no token it issues can be validated")
+
+	// JwtUnreachableJwksUri defines a diag.MessageType for message "JwtUnreachableJwksUri".
+	// Description: A JWT origin's jwksUri is not a scheme Envoy can fetch.
+	JwtUnreachableJwksUri = diag.NewMessageType(diag.Error, "IST0151", "JWT jwksUri %q is not a URI Envoy can fetch (must be http://, https:// or file://)")
+
+	// JwtClaimWithoutIssuer defines a diag.MessageType for message "JwtClaimWithoutIssuer".
+	// Description: A ServiceRole constraint on request.auth.claims[iss] names an issuer no Policy in the mesh configures.
+	JwtClaimWithoutIssuer = diag.NewMessageType(diag.Error, "IST0152", "this rule requires a validated claim from issuer %q, but no authentication Policy configures that issuer")
+
+	// JwtClaimIssuerNotConfiguredForWorkload defines a diag.MessageType for message "JwtClaimIssuerNotConfiguredForWorkload".
+	// Description: A ServiceRole constraint names an issuer that is configured somewhere in the mesh, but not for the service the rule selects.
+	JwtClaimIssuerNotConfiguredForWorkload = diag.NewMessageType(diag.Warning, "IST0153",
+		"this rule requires a validated claim from issuer %q, but no authentication Policy configures that issuer for %q")
+
+	// JwtAudienceUnknownHost defines a diag.MessageType for message "JwtAudienceUnknownHost".
+	// Description: A JWT origin's audience doesn't match any known mesh service, suggesting a typo or a token minted for a different mesh.
+	JwtAudienceUnknownHost = diag.NewMessageType(diag.Warning, "IST0154", "JWT audience %q does not match any known service in the mesh")
+
+	// EgressSidecarHostNotFound defines a diag.MessageType for message "EgressSidecarHostNotFound".
+	// Description: A Sidecar egress host doesn't resolve to either an in-mesh Service or a ServiceEntry.
+	EgressSidecarHostNotFound = diag.NewMessageType(diag.Error, "IST0160", "Sidecar egress host %q does not match any known Service or ServiceEntry")
+
+	// EgressServiceEntryPortCollision defines a diag.MessageType for message "EgressServiceEntryPortCollision".
+	// Description: A ServiceEntry declares a host/port/protocol that collides with an in-mesh Service's own port.
+	EgressServiceEntryPortCollision = diag.NewMessageType(diag.Warning, "IST0161",
+		"ServiceEntry port %q collides with an in-mesh Service port of the same host, number and protocol")
+
+	// EgressDestinationRuleHostIsMeshInternal defines a diag.MessageType for message "EgressDestinationRuleHostIsMeshInternal".
+	// Description: A DestinationRule targets a host that a ServiceEntry declares MESH_INTERNAL, which never applies to external traffic.
+	EgressDestinationRuleHostIsMeshInternal = diag.NewMessageType(diag.Warning, "IST0162",
+		"DestinationRule host %q is a MESH_INTERNAL ServiceEntry; this rule never applies to traffic actually leaving the mesh")
+
+	// EgressVirtualServiceHostNotFound defines a diag.MessageType for message "EgressVirtualServiceHostNotFound".
+	// Description: A VirtualService host doesn't resolve to either an in-mesh Service or a ServiceEntry.
+	EgressVirtualServiceHostNotFound = diag.NewMessageType(diag.Error, "IST0163", "VirtualService host %q does not match any known Service or ServiceEntry")
+)
+
+// NewJwtIssuerNotConfigured returns a new diag.Message based on JwtIssuerNotConfigured.
+func NewJwtIssuerNotConfigured(r *resource.Instance, issuer string) diag.Message {
+	return diag.NewMessage(JwtIssuerNotConfigured, r, issuer)
+}
+
+// NewJwtUnreachableJwksUri returns a new diag.Message based on JwtUnreachableJwksUri.
+func NewJwtUnreachableJwksUri(r *resource.Instance, jwksURI string) diag.Message {
+	return diag.NewMessage(JwtUnreachableJwksUri, r, jwksURI)
+}
+
+// NewJwtClaimWithoutIssuer returns a new diag.Message based on JwtClaimWithoutIssuer.
+func NewJwtClaimWithoutIssuer(r *resource.Instance, issuer string) diag.Message {
+	return diag.NewMessage(JwtClaimWithoutIssuer, r, issuer)
+}
+
+// NewJwtClaimIssuerNotConfiguredForWorkload returns a new diag.Message based on JwtClaimIssuerNotConfiguredForWorkload.
+func NewJwtClaimIssuerNotConfiguredForWorkload(r *resource.Instance, issuer string, host string) diag.Message {
+	return diag.NewMessage(JwtClaimIssuerNotConfiguredForWorkload, r, issuer, host)
+}
+
+// NewJwtAudienceUnknownHost returns a new diag.Message based on JwtAudienceUnknownHost.
+func NewJwtAudienceUnknownHost(r *resource.Instance, audience string) diag.Message {
+	return diag.NewMessage(JwtAudienceUnknownHost, r, audience)
+}
+
+// NewEgressSidecarHostNotFound returns a new diag.Message based on EgressSidecarHostNotFound.
+func NewEgressSidecarHostNotFound(r *resource.Instance, host string) diag.Message {
+	return diag.NewMessage(EgressSidecarHostNotFound, r, host)
+}
+
+// NewEgressServiceEntryPortCollision returns a new diag.Message based on EgressServiceEntryPortCollision.
+func NewEgressServiceEntryPortCollision(r *resource.Instance, port string) diag.Message {
+	return diag.NewMessage(EgressServiceEntryPortCollision, r, port)
+}
+
+// NewEgressDestinationRuleHostIsMeshInternal returns a new diag.Message based on EgressDestinationRuleHostIsMeshInternal.
+func NewEgressDestinationRuleHostIsMeshInternal(r *resource.Instance, host string) diag.Message {
+	return diag.NewMessage(EgressDestinationRuleHostIsMeshInternal, r, host)
+}
+
+// NewEgressVirtualServiceHostNotFound returns a new diag.Message based on EgressVirtualServiceHostNotFound.
+func NewEgressVirtualServiceHostNotFound(r *resource.Instance, host string) diag.Message {
+	return diag.NewMessage(EgressVirtualServiceHostNotFound, r, host)
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+// HotRestartStrategy controls how envoy.Run transitions between hot-restart epochs.
+type HotRestartStrategy string
+
+const (
+	// HotRestartTimer is the original behavior: the new epoch is started with
+	// --parent-shutdown-time-s and Envoy's own internal timer kills the old epoch.
+	HotRestartTimer HotRestartStrategy = "Timer"
+
+	// HotRestartAdminAware gates the old epoch's shutdown on live signals from the new
+	// epoch's admin API instead of a fixed timer.
+	HotRestartAdminAware HotRestartStrategy = "AdminAware"
+
+	// adminPollInterval is how often the new epoch's admin API is polled for readiness.
+	adminPollInterval = 200 * time.Millisecond
+
+	// drainPollInterval is how often a draining epoch's downstream_cx_active stat is polled.
+	drainPollInterval = 500 * time.Millisecond
+)
+
+// EpochState is the lifecycle state of a single hot-restart epoch, as observed through
+// the admin API.
+type EpochState string
+
+const (
+	EpochPending    EpochState = "pending"    // process started, not yet confirmed live
+	EpochLive       EpochState = "live"       // admin API reports LIVE and listeners warmed
+	EpochDraining   EpochState = "draining"   // told to shut down, waiting on active connections
+	EpochTerminated EpochState = "terminated" // process has exited
+	EpochFailed     EpochState = "failed"     // never became live before giving up
+)
+
+// adminPortForEpoch returns the admin API port orchestrateHotRestart should use to talk
+// to a given epoch. Every epoch shares the same configured admin port: Envoy's hot
+// restart hands that listening socket off from parent to child rather than opening a new
+// one, and external consumers (readiness probes, metrics scraping, pilot-agent) expect to
+// keep finding it there, so nothing here ever relocates it.
+func (e *envoy) adminPortForEpoch(int) uint32 {
+	return uint32(e.Config.ProxyAdminPort)
+}
+
+// EpochStatus returns the last observed state of epoch, or "" if epoch is unknown.
+func (e *envoy) EpochStatus(epoch int) EpochState {
+	v, ok := e.epochState.Load(epoch)
+	if !ok {
+		return ""
+	}
+	return v.(EpochState)
+}
+
+func (e *envoy) setEpochState(epoch int, s EpochState) {
+	e.epochState.Store(epoch, s)
+	log.Infof("hot restart: epoch %d is now %s", epoch, s)
+}
+
+func (e *envoy) setEpochProcess(epoch int, cmd *exec.Cmd) {
+	e.epochProcs.Store(epoch, cmd)
+}
+
+func (e *envoy) getEpochProcess(epoch int) (*exec.Cmd, bool) {
+	v, ok := e.epochProcs.Load(epoch)
+	if !ok {
+		return nil, false
+	}
+	return v.(*exec.Cmd), true
+}
+
+// orchestrateHotRestart waits for the just-started epoch to become live, then drains
+// and terminates the previous epoch. It never blocks Run's own caller: it is started in
+// its own goroutine and logs/records its progress via epochState for the agent to poll.
+func (e *envoy) orchestrateHotRestart(epoch int, adminPort uint32) {
+	e.setEpochState(epoch, EpochPending)
+
+	if !e.waitUntilLive(adminPort, convertDuration(e.Config.ParentShutdownDuration)) {
+		e.setEpochState(epoch, EpochFailed)
+		log.Warnf("hot restart: epoch %d never became live over admin port %d, leaving epoch %d to its own --parent-shutdown-time-s timer",
+			epoch, adminPort, epoch-1)
+		return
+	}
+	e.setEpochState(epoch, EpochLive)
+
+	prevCmd, ok := e.getEpochProcess(epoch - 1)
+	if !ok {
+		// First epoch, or we were never told about the previous one: nothing to drain.
+		return
+	}
+
+	prevAdminPort := e.adminPortForEpoch(epoch - 1)
+	if err := requestGracefulDrain(prevAdminPort); err != nil {
+		log.Warnf("hot restart: failed to request graceful drain on epoch %d, sending SIGTERM: %v", epoch-1, err)
+	}
+	if err := prevCmd.Process.Signal(syscall.SIGTERM); err != nil {
+		log.Warnf("hot restart: failed to signal epoch %d: %v", epoch-1, err)
+	}
+	e.setEpochState(epoch-1, EpochDraining)
+
+	maxDrain := convertDuration(e.Config.DrainDuration)
+	if !waitForDrain(prevAdminPort, maxDrain) {
+		log.Warnf("hot restart: epoch %d still has active connections after %s, killing it", epoch-1, maxDrain)
+		if err := prevCmd.Process.Kill(); err != nil {
+			log.Warnf("hot restart: failed to kill epoch %d: %v", epoch-1, err)
+		}
+	}
+	e.setEpochState(epoch-1, EpochTerminated)
+}
+
+// waitUntilLive polls /server_info and the listener_manager.workers_started stat until
+// the epoch on adminPort reports itself live and warmed, or timeout elapses.
+func (e *envoy) waitUntilLive(adminPort uint32, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if e.isLiveOnPort(adminPort) && workersStarted(adminPort) {
+			return true
+		}
+		time.Sleep(adminPollInterval)
+	}
+	return false
+}
+
+func (e *envoy) isLiveOnPort(adminPort uint32) bool {
+	info, err := GetServerInfo(adminPort)
+	if err != nil {
+		return false
+	}
+	return info.State.String() == "LIVE"
+}
+
+// workersStarted reports whether the new epoch's worker threads have finished warming
+// up all listeners, via the listener_manager.workers_started stat.
+func workersStarted(adminPort uint32) bool {
+	body, err := adminGet(adminPort, "/stats?filter=listener_manager.workers_started&format=json")
+	if err != nil {
+		return false
+	}
+	return statValue(body, "listener_manager.workers_started") == 1
+}
+
+// waitForDrain polls downstream_cx_active on adminPort until it reaches zero or timeout
+// elapses, returning whether it drained in time.
+func waitForDrain(adminPort uint32, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		body, err := adminGet(adminPort, "/stats?filter=downstream_cx_active&format=json")
+		if err != nil {
+			// The process may already have exited; treat that as drained.
+			return true
+		}
+		if statValue(body, "downstream_cx_active") == 0 {
+			return true
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return false
+}
+
+func requestGracefulDrain(adminPort uint32) error {
+	_, err := adminPost(adminPort, "/drain_listeners?graceful")
+	return err
+}
+
+type adminStats struct {
+	Stats []struct {
+		Name  string `json:"name"`
+		Value int64  `json:"value"`
+	} `json:"stats"`
+}
+
+// statValue extracts a single named stat's value out of an admin /stats?format=json
+// response body, returning -1 if it wasn't present.
+func statValue(body []byte, name string) int64 {
+	var stats adminStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return -1
+	}
+	for _, s := range stats.Stats {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+	return -1
+}
+
+func adminGet(adminPort uint32, path string) ([]byte, error) {
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", adminPort, path))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin GET %s returned %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func adminPost(adminPort uint32, path string) ([]byte, error) {
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d%s", adminPort, path), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin POST %s returned %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/gomega"
+)
+
+// fakeAdminServer is a minimal stand-in for Envoy's admin API, serving just the
+// endpoints orchestrateHotRestart polls.
+type fakeAdminServer struct {
+	srv                *httptest.Server
+	port               uint32
+	workersStarted     int32 // atomic bool, 0 or 1
+	downstreamCxActive int64
+	drainRequested     int32 // atomic bool, 0 or 1
+}
+
+func newFakeAdminServer(t *testing.T) *fakeAdminServer {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to allocate fake admin port: %v", err)
+	}
+
+	f := &fakeAdminServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/server_info", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state":"LIVE"}`)
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("filter")
+		var value int64
+		switch filter {
+		case "listener_manager.workers_started":
+			if atomic.LoadInt32(&f.workersStarted) == 1 {
+				value = 1
+			}
+		case "downstream_cx_active":
+			value = atomic.LoadInt64(&f.downstreamCxActive)
+		}
+		fmt.Fprintf(w, `{"stats":[{"name":%q,"value":%d}]}`, filter, value)
+	})
+	mux.HandleFunc("/drain_listeners", func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&f.drainRequested, 1)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	f.srv = &httptest.Server{Listener: lis, Config: &http.Server{Handler: mux}}
+	f.srv.Start()
+	t.Cleanup(f.srv.Close)
+
+	_, portStr, _ := net.SplitHostPort(lis.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	f.port = uint32(port)
+	return f
+}
+
+func TestWorkersStarted(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	admin := newFakeAdminServer(t)
+	g.Expect(workersStarted(admin.port)).To(BeFalse())
+
+	atomic.StoreInt32(&admin.workersStarted, 1)
+	g.Expect(workersStarted(admin.port)).To(BeTrue())
+}
+
+func TestWaitForDrain_alreadyDrained(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	admin := newFakeAdminServer(t)
+	g.Expect(waitForDrain(admin.port, 200*time.Millisecond)).To(BeTrue())
+}
+
+func TestWaitForDrain_timesOutWithActiveConnections(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	admin := newFakeAdminServer(t)
+	atomic.StoreInt64(&admin.downstreamCxActive, 5)
+
+	g.Expect(waitForDrain(admin.port, 50*time.Millisecond)).To(BeFalse())
+}
+
+func TestWaitForDrain_processGone(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// No server listening on this port at all: adminGet fails immediately, which
+	// waitForDrain treats as "already drained" (the process exited).
+	g.Expect(waitForDrain(unusedPort(t), 200*time.Millisecond)).To(BeTrue())
+}
+
+func TestRequestGracefulDrain(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	admin := newFakeAdminServer(t)
+	g.Expect(requestGracefulDrain(admin.port)).To(Succeed())
+	g.Expect(atomic.LoadInt32(&admin.drainRequested)).To(BeEquivalentTo(1))
+}
+
+// TestOrchestrateHotRestart_oldEpochDrainsInTime exercises the full orchestration: the
+// new epoch's admin server reports live+warmed immediately, and the previous epoch's
+// admin server reports its connections draining to zero well inside DrainDuration.
+func TestOrchestrateHotRestart_oldEpochDrainsInTime(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	e := &envoy{}
+	e.HotRestartStrategy = HotRestartAdminAware
+	e.Config.DrainDuration = types.DurationProto(2 * time.Second)
+	e.Config.ParentShutdownDuration = types.DurationProto(2 * time.Second)
+
+	prevAdmin := newFakeAdminServer(t)
+	atomic.StoreInt64(&prevAdmin.downstreamCxActive, 0)
+	// adminPortForEpoch always resolves to the configured admin port, so pointing it at
+	// the previous epoch's fake admin server lets orchestrateHotRestart find it.
+	e.Config.ProxyAdminPort = int32(prevAdmin.port)
+
+	prevCmd := exec.Command("sleep", "5")
+	if err := prevCmd.Start(); err != nil {
+		t.Fatalf("failed to start fake previous-epoch process: %v", err)
+	}
+	t.Cleanup(func() { _ = prevCmd.Process.Kill() })
+	e.setEpochProcess(0, prevCmd)
+
+	newAdmin := newFakeAdminServer(t)
+	atomic.StoreInt32(&newAdmin.workersStarted, 1)
+
+	e.orchestrateHotRestart(1, newAdmin.port)
+
+	g.Expect(e.EpochStatus(1)).To(Equal(EpochLive))
+	g.Expect(e.EpochStatus(0)).To(Equal(EpochTerminated))
+}
+
+// TestOrchestrateHotRestart_newEpochNeverLive exercises the abort path: the new epoch's
+// admin server never reports its workers started, so orchestrateHotRestart gives up
+// without touching the previous epoch at all, leaving it to --parent-shutdown-time-s.
+func TestOrchestrateHotRestart_newEpochNeverLive(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	e := &envoy{}
+	e.HotRestartStrategy = HotRestartAdminAware
+	e.Config.ParentShutdownDuration = types.DurationProto(100 * time.Millisecond)
+
+	prevAdmin := newFakeAdminServer(t)
+	e.Config.ProxyAdminPort = int32(prevAdmin.port)
+
+	prevCmd := exec.Command("sleep", "5")
+	if err := prevCmd.Start(); err != nil {
+		t.Fatalf("failed to start fake previous-epoch process: %v", err)
+	}
+	t.Cleanup(func() { _ = prevCmd.Process.Kill() })
+	e.setEpochProcess(0, prevCmd)
+
+	// workersStarted is left false, so waitUntilLive never succeeds.
+	newAdmin := newFakeAdminServer(t)
+
+	e.orchestrateHotRestart(1, newAdmin.port)
+
+	g.Expect(e.EpochStatus(1)).To(Equal(EpochFailed))
+	g.Expect(e.EpochStatus(0)).To(BeEmpty())
+	g.Expect(atomic.LoadInt32(&prevAdmin.drainRequested)).To(BeEquivalentTo(0))
+}
+
+// TestOrchestrateHotRestart_oldEpochForceKilled exercises the force-kill path: the
+// previous epoch still has active connections after DrainDuration elapses, so
+// orchestrateHotRestart kills it outright instead of waiting indefinitely.
+func TestOrchestrateHotRestart_oldEpochForceKilled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	e := &envoy{}
+	e.HotRestartStrategy = HotRestartAdminAware
+	e.Config.DrainDuration = types.DurationProto(50 * time.Millisecond)
+	e.Config.ParentShutdownDuration = types.DurationProto(2 * time.Second)
+
+	prevAdmin := newFakeAdminServer(t)
+	atomic.StoreInt64(&prevAdmin.downstreamCxActive, 5)
+	e.Config.ProxyAdminPort = int32(prevAdmin.port)
+
+	prevCmd := exec.Command("sleep", "5")
+	if err := prevCmd.Start(); err != nil {
+		t.Fatalf("failed to start fake previous-epoch process: %v", err)
+	}
+	t.Cleanup(func() { _ = prevCmd.Process.Kill() })
+	e.setEpochProcess(0, prevCmd)
+
+	newAdmin := newFakeAdminServer(t)
+	atomic.StoreInt32(&newAdmin.workersStarted, 1)
+
+	e.orchestrateHotRestart(1, newAdmin.port)
+
+	g.Expect(e.EpochStatus(0)).To(Equal(EpochTerminated))
+	err := prevCmd.Wait()
+	g.Expect(err).To(HaveOccurred(), "expected the previous epoch to have been killed")
+}
+
+func unusedPort(t *testing.T) uint32 {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to allocate a port: %v", err)
+	}
+	_, portStr, _ := net.SplitHostPort(lis.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	_ = lis.Close()
+	return uint32(port)
+}
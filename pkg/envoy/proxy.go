@@ -15,15 +15,18 @@
 package envoy
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"path"
+	"sync"
 	"time"
 
 	envoyAdmin "github.com/envoyproxy/go-control-plane/envoy/admin/v2alpha"
+	bootstrapv2 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
 	"github.com/gogo/protobuf/types"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
@@ -44,6 +47,12 @@ const (
 type envoy struct {
 	ProxyConfig
 	extraArgs []string
+
+	// epochState and epochProcs track, across successive calls to Run, the observed
+	// admin-API state and process handle of every epoch started so far. They're only
+	// consulted when HotRestartStrategy is HotRestartAdminAware.
+	epochState sync.Map // map[int]EpochState
+	epochProcs sync.Map // map[int]*exec.Cmd
 }
 
 type ProxyConfig struct {
@@ -62,6 +71,14 @@ type ProxyConfig struct {
 	SDSTokenPath        string
 	ControlPlaneAuth    bool
 	DisableReportCalls  bool
+
+	// HotRestartStrategy selects how Run transitions between successive epochs.
+	// Defaults to HotRestartTimer (the historical behavior) when unset.
+	HotRestartStrategy HotRestartStrategy
+
+	// BootstrapTransformers run in order over the generated bootstrap configuration
+	// before it's written to disk. ISTIO_BOOTSTRAP_OVERRIDE, if set, is applied last.
+	BootstrapTransformers []BootstrapTransformer
 }
 
 // NewProxy creates an instance of the proxy control commands
@@ -98,7 +115,7 @@ func (e *envoy) IsLive() bool {
 	return false
 }
 
-func (e *envoy) args(fname string, epoch int, bootstrapConfig string) []string {
+func (e *envoy) args(fname string, epoch int) []string {
 	proxyLocalAddressType := "v4"
 	if isIPv6Proxy(e.NodeIPs) {
 		proxyLocalAddressType = "v6"
@@ -115,15 +132,6 @@ func (e *envoy) args(fname string, epoch int, bootstrapConfig string) []string {
 
 	startupArgs = append(startupArgs, e.extraArgs...)
 
-	if bootstrapConfig != "" {
-		bytes, err := ioutil.ReadFile(bootstrapConfig)
-		if err != nil {
-			log.Warnf("Failed to read bootstrap override %s, %v", bootstrapConfig, err)
-		} else {
-			startupArgs = append(startupArgs, "--config-yaml", string(bytes))
-		}
-	}
-
 	if e.Config.Concurrency > 0 {
 		startupArgs = append(startupArgs, "--concurrency", fmt.Sprint(e.Config.Concurrency))
 	}
@@ -133,6 +141,22 @@ func (e *envoy) args(fname string, epoch int, bootstrapConfig string) []string {
 
 var istioBootstrapOverrideVar = env.RegisterStringVar("ISTIO_BOOTSTRAP_OVERRIDE", "", "")
 
+// bootstrapTransformers returns the transformer chain to run over a generated or custom
+// bootstrap: the operator-registered BootstrapTransformers, followed by
+// ISTIO_BOOTSTRAP_OVERRIDE last so it has the final say, matching its old
+// "--config-yaml" behavior of overriding everything generated before it. No admin-port
+// transformer is added here: unless an operator registers an AdminPortTransformer, every
+// epoch, under every HotRestartStrategy, keeps Config.ProxyAdminPort, since Envoy's hot restart hands that listening socket off from
+// parent to child and readiness probes, metrics scraping, and pilot-agent all expect it
+// to stay put.
+func (e *envoy) bootstrapTransformers() []BootstrapTransformer {
+	transformers := e.BootstrapTransformers
+	if override := istioBootstrapOverrideVar.Get(); override != "" {
+		transformers = append(transformers, &IstioBootstrapOverrideTransformer{File: override})
+	}
+	return transformers
+}
+
 func (e *envoy) Run(config interface{}, epoch int, abort <-chan error) error {
 	var fname string
 	// Note: the cert checking still works, the generated file is updated if certs are changed.
@@ -144,8 +168,29 @@ func (e *envoy) Run(config interface{}, epoch int, abort <-chan error) error {
 	} else if len(e.Config.CustomConfigFile) > 0 {
 		// there is a custom configuration. Don't write our own config - but keep watching the certs.
 		fname = e.Config.CustomConfigFile
+
+		// Still run the bootstrap transformer pipeline (most importantly
+		// ISTIO_BOOTSTRAP_OVERRIDE) over it: operators combining CustomConfigFile with
+		// the override env var relied on it being applied unconditionally before the
+		// transformer pipeline existed, and silently dropping it here would be a
+		// regression for them.
+		custom := &bootstrapv2.Bootstrap{}
+		contents, err := ioutil.ReadFile(e.Config.CustomConfigFile)
+		if err != nil {
+			log.Warnf("Failed to read custom bootstrap config %s, leaving it untransformed: %v", e.Config.CustomConfigFile, err)
+		} else if err := unmarshalBootstrap(contents, custom); err != nil {
+			log.Warnf("Custom bootstrap config %s isn't a recognizable Envoy bootstrap, leaving it untransformed: %v", e.Config.CustomConfigFile, err)
+		} else if err := applyBootstrapTransformers(context.Background(), custom, e.bootstrapTransformers()); err != nil {
+			log.Errora("Failed to apply bootstrap transformers to custom config: ", err)
+			return err
+		} else if out, err := writeBootstrapFile(custom, e.Config.ConfigPath, epoch); err != nil {
+			log.Errora("Failed to write transformed custom bootstrap config: ", err)
+			return err
+		} else {
+			fname = out
+		}
 	} else {
-		out, err := bootstrap.New(bootstrap.Config{
+		gen := bootstrap.New(bootstrap.Config{
 			Node:                e.Node,
 			DNSRefreshRate:      e.DNSRefreshRate,
 			Proxy:               &e.Config,
@@ -160,17 +205,43 @@ func (e *envoy) Run(config interface{}, epoch int, abort <-chan error) error {
 			SDSTokenPath:        e.SDSTokenPath,
 			ControlPlaneAuth:    e.ControlPlaneAuth,
 			DisableReportCalls:  e.DisableReportCalls,
-		}).CreateFileForEpoch(epoch)
+		})
+
+		out, err := gen.CreateFileForEpoch(epoch)
 		if err != nil {
 			log.Errora("Failed to generate bootstrap config: ", err)
 			os.Exit(1) // Prevent infinite loop attempting to write the file, let k8s/systemd report
 			return err
 		}
+
+		// Only parse the templated JSON back into a proto (and rewrite it) when there's
+		// actually a transformer to run over it; most proxies run with none configured.
+		if transformers := e.bootstrapTransformers(); len(transformers) > 0 {
+			contents, err := ioutil.ReadFile(out)
+			if err != nil {
+				log.Errora("Failed to read generated bootstrap config: ", err)
+				return err
+			}
+			generated := &bootstrapv2.Bootstrap{}
+			if err := unmarshalBootstrap(contents, generated); err != nil {
+				log.Errora("Failed to parse generated bootstrap config: ", err)
+				return err
+			}
+			if err := applyBootstrapTransformers(context.Background(), generated, transformers); err != nil {
+				log.Errora("Failed to apply bootstrap transformers: ", err)
+				return err
+			}
+			if _, err := writeBootstrapFile(generated, e.Config.ConfigPath, epoch); err != nil {
+				log.Errora("Failed to write bootstrap config: ", err)
+				os.Exit(1) // Prevent infinite loop attempting to write the file, let k8s/systemd report
+				return err
+			}
+		}
 		fname = out
 	}
 
 	// spin up a new Envoy process
-	args := e.args(fname, epoch, istioBootstrapOverrideVar.Get())
+	args := e.args(fname, epoch)
 	log.Infof("Envoy command: %v", args)
 
 	/* #nosec */
@@ -180,6 +251,11 @@ func (e *envoy) Run(config interface{}, epoch int, abort <-chan error) error {
 	if err := cmd.Start(); err != nil {
 		return err
 	}
+	e.setEpochProcess(epoch, cmd)
+	if e.HotRestartStrategy == HotRestartAdminAware && epoch > 0 {
+		go e.orchestrateHotRestart(epoch, e.adminPortForEpoch(epoch))
+	}
+
 	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Wait()
@@ -0,0 +1,158 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	bootstrapv2 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+	metricsv2 "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v2"
+	. "github.com/onsi/gomega"
+)
+
+func canonicalBootstrap() *bootstrapv2.Bootstrap {
+	return &bootstrapv2.Bootstrap{
+		Admin: &bootstrapv2.Admin{
+			AccessLogPath: "/dev/stdout",
+			Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+				Address:       "127.0.0.1",
+				PortSpecifier: &core.SocketAddress_PortValue{PortValue: 15000},
+			}}},
+		},
+	}
+}
+
+func TestAdminPortTransformer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	xform := &AdminPortTransformer{Port: 15099}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	socketAddr := b.Admin.Address.GetSocketAddress()
+	g.Expect(socketAddr.GetPortValue()).To(BeEquivalentTo(15099))
+	g.Expect(socketAddr.Address).To(Equal("127.0.0.1"))
+}
+
+func TestAdminAccessLogTransformer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	xform := &AdminAccessLogTransformer{AccessLogPath: "/dev/stderr"}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	g.Expect(b.Admin.AccessLogPath).To(Equal("/dev/stderr"))
+}
+
+func TestStatsSinkTransformer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	sink := &metricsv2.StatsSink{Name: "envoy.statsd"}
+	xform := &StatsSinkTransformer{Sink: sink}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	g.Expect(b.StatsSinks).To(ConsistOf(sink))
+}
+
+func TestRuntimeLayerTransformer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	xform := &RuntimeLayerTransformer{
+		Name:   "istio-override",
+		Values: map[string]interface{}{"re2.max_program_size.error_level": 1024},
+	}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	g.Expect(b.LayeredRuntime.Layers).To(HaveLen(1))
+	g.Expect(b.LayeredRuntime.Layers[0].Name).To(Equal("istio-override"))
+}
+
+func TestJSONPatchTransformer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	patchFile := filepath.Join(dir, "patch.json")
+	patch := `[{"op":"replace","path":"/admin/access_log_path","value":"/dev/null"}]`
+	g.Expect(ioutil.WriteFile(patchFile, []byte(patch), 0644)).To(Succeed())
+
+	b := canonicalBootstrap()
+	xform := &JSONPatchTransformer{PatchFile: patchFile}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	g.Expect(b.Admin.AccessLogPath).To(Equal("/dev/null"))
+}
+
+func TestIstioBootstrapOverrideTransformer_yamlReplacesRepeatedField(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	b.StatsSinks = append(b.StatsSinks, &metricsv2.StatsSink{Name: "envoy.statsd"})
+
+	dir := t.TempDir()
+	overrideFile := filepath.Join(dir, "override.yaml")
+	override := "admin:\n  access_log_path: /dev/null\nstats_sinks:\n  - name: envoy.dog_statsd\n"
+	g.Expect(ioutil.WriteFile(overrideFile, []byte(override), 0644)).To(Succeed())
+
+	xform := &IstioBootstrapOverrideTransformer{File: overrideFile}
+	g.Expect(xform.Transform(context.Background(), b)).To(Succeed())
+
+	// The override replaces stats_sinks outright rather than appending to it.
+	g.Expect(b.StatsSinks).To(HaveLen(1))
+	g.Expect(b.StatsSinks[0].Name).To(Equal("envoy.dog_statsd"))
+	// The override's admin field is merged in, while fields it didn't touch, like the
+	// admin address, are left alone.
+	g.Expect(b.Admin.AccessLogPath).To(Equal("/dev/null"))
+	g.Expect(b.Admin.Address.GetSocketAddress().GetPortValue()).To(BeEquivalentTo(15000))
+}
+
+// TestApplyBootstrapTransformers_chain runs several transformers through the pipeline in
+// order, verifying that each sees the previous one's output.
+func TestApplyBootstrapTransformers_chain(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	transformers := []BootstrapTransformer{
+		&AdminAccessLogTransformer{AccessLogPath: "/dev/stderr"},
+		&AdminPortTransformer{Port: 15099},
+	}
+	g.Expect(applyBootstrapTransformers(context.Background(), b, transformers)).To(Succeed())
+
+	g.Expect(b.Admin.AccessLogPath).To(Equal("/dev/stderr"))
+	g.Expect(b.Admin.Address.GetSocketAddress().GetPortValue()).To(BeEquivalentTo(15099))
+}
+
+func TestApplyBootstrapTransformers_stopsAtFirstError(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := canonicalBootstrap()
+	transformers := []BootstrapTransformer{
+		&AdminAccessLogTransformer{AccessLogPath: "/dev/stderr"},
+		&JSONPatchTransformer{PatchFile: filepath.Join(t.TempDir(), "does-not-exist.json")},
+		&AdminPortTransformer{Port: 15099},
+	}
+	err := applyBootstrapTransformers(context.Background(), b, transformers)
+	g.Expect(err).To(HaveOccurred())
+
+	// The first transformer's effect should still be visible; the one after the failing
+	// transformer should never have run.
+	g.Expect(b.Admin.AccessLogPath).To(Equal("/dev/stderr"))
+	g.Expect(b.Admin.Address.GetSocketAddress().GetPortValue()).To(BeEquivalentTo(15000))
+}